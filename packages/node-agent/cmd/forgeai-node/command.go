@@ -0,0 +1,402 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ─── Signed Command Execution ────────────────────────────
+//
+// handleCommand, handleListProcesses, handleKillProcess and
+// handleContainerAction all let the gateway act on the node, so all four
+// go through authorizeCommand before doing anything: with --trust-keys
+// configured, the message must carry an Ed25519 signature over its own
+// fields; with --policy configured, the specifics are additionally
+// checked against an allowlist. Output for "command" is streamed as
+// command_output frames as the process runs rather than buffered until
+// exit, so long jobs are observable in real time and aren't lost if the
+// timeout kills them.
+
+const commandStreamChunkSize = 4096
+
+// Policy declares what a signed command is allowed to do. A nil policy
+// (no --policy flag) allows everything, mirroring how --trust-keys being
+// unset leaves signature verification off — both are opt-in hardening.
+type Policy struct {
+	AllowedBinaries       []string `json:"allowedBinaries" yaml:"allowedBinaries"`
+	ArgPatterns           []string `json:"argPatterns" yaml:"argPatterns"`
+	MaxTimeoutMs          int64    `json:"maxTimeoutMs" yaml:"maxTimeoutMs"`
+	AllowShell            bool     `json:"allowShell" yaml:"allowShell"`
+	AllowProcessControl   bool     `json:"allowProcessControl" yaml:"allowProcessControl"`
+	AllowContainerControl bool     `json:"allowContainerControl" yaml:"allowContainerControl"`
+
+	argRe []*regexp.Regexp
+}
+
+// loadPolicy reads a policy file, parsing it as JSON if the extension is
+// .json and YAML otherwise.
+func loadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(data, &p)
+	} else {
+		err = yaml.Unmarshal(data, &p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+
+	for _, pat := range p.ArgPatterns {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, fmt.Errorf("argPatterns %q: %w", pat, err)
+		}
+		p.argRe = append(p.argRe, re)
+	}
+
+	return &p, nil
+}
+
+// allows reports whether cmd/args/timeout are all permitted, returning
+// the reason for rejection if not.
+func (p *Policy) allows(cmd string, args []string, timeout time.Duration) error {
+	if p == nil {
+		return nil
+	}
+
+	if len(args) == 0 && !p.AllowShell {
+		return fmt.Errorf("shell execution is disabled by policy")
+	}
+
+	if len(p.AllowedBinaries) > 0 {
+		allowed := false
+		for _, b := range p.AllowedBinaries {
+			if b == cmd {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("binary %q is not in the policy allowlist", cmd)
+		}
+	}
+
+	for _, arg := range args {
+		matched := len(p.argRe) == 0
+		for _, re := range p.argRe {
+			if re.MatchString(arg) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("argument %q does not match any policy argPatterns", arg)
+		}
+	}
+
+	if p.MaxTimeoutMs > 0 && timeout > time.Duration(p.MaxTimeoutMs)*time.Millisecond {
+		return fmt.Errorf("timeout %s exceeds policy max of %dms", timeout, p.MaxTimeoutMs)
+	}
+
+	return nil
+}
+
+// parseTrustKeys decodes a comma-separated list of base64 Ed25519 public
+// keys, as passed to --trust-keys / FORGEAI_TRUST_KEYS.
+func parseTrustKeys(csv string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, part := range strings.Split(csv, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 key %q: %w", part, err)
+		}
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %q is %d bytes, want %d", part, len(raw), ed25519.PublicKeySize)
+		}
+		keys = append(keys, ed25519.PublicKey(raw))
+	}
+	return keys, nil
+}
+
+// commandSelector returns the type-specific fields a signature must bind
+// for msg, so that the signed payload actually covers the parameters
+// that drive execution for that message type rather than always the
+// "command" fields (which are empty for the others).
+func commandSelector(msg Message) string {
+	switch msg.Type {
+	case "command":
+		return msg.Cmd + " " + strings.Join(msg.Args, " ")
+	case "kill_process":
+		return strconv.Itoa(int(msg.Pid)) + " " + msg.Signal
+	case "container_action":
+		return msg.Action + " " + msg.ContainerId
+	default:
+		return ""
+	}
+}
+
+// signedCommandPayload builds the canonical bytes a command-capable
+// message's signature covers, so that tampering with the node it's
+// addressed to, the message id, its type-specific selector (see
+// commandSelector) or the timestamp all invalidate the signature.
+func signedCommandPayload(nodeId string, msg Message) []byte {
+	return []byte(strings.Join([]string{
+		nodeId,
+		msg.MsgId,
+		msg.Type,
+		commandSelector(msg),
+		strconv.FormatInt(msg.Ts, 10),
+	}, "|"))
+}
+
+// verifyCommandSignature reports whether msg.Signature is a valid
+// base64-encoded Ed25519 signature over signedCommandPayload from any
+// one of the agent's trusted keys.
+func (a *Agent) verifyCommandSignature(msg Message) bool {
+	sig, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return false
+	}
+	payload := signedCommandPayload(a.nodeInfo.NodeId, msg)
+	for _, key := range a.trustKeys {
+		if ed25519.Verify(key, payload, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandFreshnessWindow bounds how old a signed command's Ts may be.
+// Without it, a signature (which covers Ts but nothing checks it) never
+// expires, so a single message sniffed off the wire or leaked from a
+// compromised gateway could be replayed against the node forever.
+const commandFreshnessWindow = 5 * time.Second
+
+// checkFreshness rejects a signed message whose Ts is outside
+// commandFreshnessWindow of now, or whose MsgId has already been seen,
+// so a captured message can't be replayed. Seen ids are pruned as they
+// age out of the window, since nothing older can pass the Ts check
+// anyway.
+func (a *Agent) checkFreshness(msg Message) string {
+	now := nowMs()
+	age := now - msg.Ts
+	if age < 0 {
+		age = -age
+	}
+	if age > commandFreshnessWindow.Milliseconds() {
+		return "command timestamp is outside the freshness window"
+	}
+
+	a.seenMu.Lock()
+	defer a.seenMu.Unlock()
+	for id, seenAt := range a.seenMsgIds {
+		if now-seenAt > commandFreshnessWindow.Milliseconds() {
+			delete(a.seenMsgIds, id)
+		}
+	}
+	if _, dup := a.seenMsgIds[msg.MsgId]; dup {
+		return "command has already been processed (replay)"
+	}
+	a.seenMsgIds[msg.MsgId] = now
+	return ""
+}
+
+// authorizeCommand gates every command-capable message type (command,
+// list_processes, kill_process, container_action) behind the same
+// signature and policy checks, returning the empty string if msg is
+// authorized or the rejection reason otherwise. Without this, only
+// "command" was hardened while the other three let a caller kill any
+// pid or drive docker unauthenticated.
+func (a *Agent) authorizeCommand(msg Message) string {
+	if len(a.trustKeys) > 0 {
+		if !a.verifyCommandSignature(msg) {
+			return "signature verification failed"
+		}
+		if reason := a.checkFreshness(msg); reason != "" {
+			return reason
+		}
+	}
+
+	if a.policy == nil {
+		return ""
+	}
+
+	switch msg.Type {
+	case "command":
+		timeout := 30 * time.Second
+		if msg.Timeout > 0 {
+			timeout = time.Duration(msg.Timeout) * time.Millisecond
+		}
+		if err := a.policy.allows(msg.Cmd, msg.Args, timeout); err != nil {
+			return err.Error()
+		}
+	case "kill_process":
+		if !a.policy.AllowProcessControl {
+			return "process control is disabled by policy"
+		}
+	case "container_action":
+		if !a.policy.AllowContainerControl {
+			return "container control is disabled by policy"
+		}
+	}
+
+	return ""
+}
+
+func (a *Agent) handleCommand(msg Message) {
+	if reason := a.authorizeCommand(msg); reason != "" {
+		log.Printf("[ForgeAI Node] Rejecting command %q: %s", msg.Cmd, reason)
+		a.rejectCommand(msg, reason)
+		return
+	}
+
+	timeout := 30 * time.Second
+	if msg.Timeout > 0 {
+		timeout = time.Duration(msg.Timeout) * time.Millisecond
+	}
+
+	log.Printf("[ForgeAI Node] Executing command: %s %s", msg.Cmd, strings.Join(msg.Args, " "))
+	start := time.Now()
+
+	var cmd *exec.Cmd
+	if len(msg.Args) > 0 {
+		cmd = exec.Command(msg.Cmd, msg.Args...)
+	} else if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", msg.Cmd)
+	} else {
+		cmd = exec.Command("sh", "-c", msg.Cmd)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		a.rejectCommand(msg, err.Error())
+		return
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		a.rejectCommand(msg, err.Error())
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		a.rejectCommand(msg, err.Error())
+		return
+	}
+
+	var seq int64
+	streamDone := make(chan struct{}, 2)
+	go a.streamCommandOutput(msg.MsgId, "stdout", stdout, &seq, streamDone)
+	go a.streamCommandOutput(msg.MsgId, "stderr", stderr, &seq, streamDone)
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+
+	var exitCode int
+	select {
+	case err := <-waitErr:
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			} else {
+				exitCode = -1
+			}
+		}
+	case <-time.After(timeout):
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+		<-waitErr
+		exitCode = -1
+	}
+
+	<-streamDone
+	<-streamDone
+
+	duration := time.Since(start).Milliseconds()
+	a.recordCommandHistory(msg.Cmd, exitCode, duration)
+
+	result := Message{
+		Type:       "command_result",
+		Ts:         nowMs(),
+		MsgId:      msg.MsgId,
+		ExitCode:   exitCode,
+		DurationMs: duration,
+	}
+	if err := a.send(result); err != nil {
+		log.Printf("[ForgeAI Node] Failed to send command_result: %v", err)
+	}
+}
+
+// streamCommandOutput forwards a running command's stdout or stderr as
+// command_output frames. Each send is synchronous, so the next chunk is
+// not read until the transport's Send has returned (for the WebSocket
+// transport, once the frame is written under its write mutex), and a
+// fast-writing process meets backpressure rather than being buffered
+// unboundedly in memory.
+func (a *Agent) streamCommandOutput(msgId, stream string, r io.Reader, seq *int64, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+
+	buf := make([]byte, commandStreamChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			out := Message{
+				Type:   "command_output",
+				Ts:     nowMs(),
+				MsgId:  msgId,
+				Stream: stream,
+				Chunk:  string(buf[:n]),
+				Seq:    atomic.AddInt64(seq, 1),
+			}
+			if sendErr := a.send(out); sendErr != nil {
+				log.Printf("[ForgeAI Node] command_output send failed: %v", sendErr)
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// rejectCommand sends a command_result short-circuiting execution, used
+// for signature/policy failures and process start-up errors.
+func (a *Agent) rejectCommand(msg Message, reason string) {
+	label := msg.Cmd
+	if label == "" {
+		label = msg.Type
+	}
+	a.recordCommandHistory(label, -1, 0)
+	result := Message{
+		Type:     "command_result",
+		Ts:       nowMs(),
+		MsgId:    msg.MsgId,
+		ExitCode: -1,
+		Stderr:   reason,
+	}
+	if err := a.send(result); err != nil {
+		log.Printf("[ForgeAI Node] Failed to send command_result: %v", err)
+	}
+}
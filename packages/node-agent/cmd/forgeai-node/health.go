@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// ─── Health ──────────────────────────────────────────────
+//
+// Health gives an operator (or an external monitor polling --status-addr)
+// a structured view of node liveness beyond "it's still connected",
+// mirroring NetBird's extended `status` command.
+
+type CapabilityProbe struct {
+	Name   string `json:"name"`
+	Ok     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type CommandHistoryEntry struct {
+	Cmd        string `json:"cmd"`
+	ExitCode   int    `json:"exitCode"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+type Health struct {
+	GatewayRTTMs      int64                 `json:"gatewayRTTMs"`
+	LastAuthAt        int64                 `json:"lastAuthAt"`
+	ReconnectAttempts int32                 `json:"reconnectAttempts"`
+	WsReadErrors      int64                 `json:"wsReadErrors"`
+	WsWriteErrors     int64                 `json:"wsWriteErrors"`
+	Capabilities      []CapabilityProbe     `json:"capabilities"`
+	RecentCommands    []CommandHistoryEntry `json:"recentCommands"`
+}
+
+func (a *Agent) healthLoop() {
+	a.sendHealth()
+
+	ticker := time.NewTicker(HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.sendHealth()
+		}
+	}
+}
+
+func (a *Agent) sendHealth() {
+	h := a.buildHealth()
+	msg := Message{Type: "health", Ts: nowMs(), Health: &h}
+	if err := a.send(msg); err != nil {
+		log.Printf("[ForgeAI Node] Failed to send health: %v", err)
+	}
+}
+
+func (a *Agent) buildHealth() Health {
+	a.cmdHistoryMu.Lock()
+	recent := make([]CommandHistoryEntry, len(a.cmdHistory))
+	copy(recent, a.cmdHistory)
+	a.cmdHistoryMu.Unlock()
+
+	return Health{
+		GatewayRTTMs:      atomic.LoadInt64(&a.rttMs),
+		LastAuthAt:        atomic.LoadInt64(&a.lastAuthAt),
+		ReconnectAttempts: atomic.LoadInt32(&a.reconnectAttempts),
+		WsReadErrors:      atomic.LoadInt64(&a.wsReadErrors),
+		WsWriteErrors:     atomic.LoadInt64(&a.wsWriteErrors),
+		Capabilities:      probeCapabilities(),
+		RecentCommands:    recent,
+	}
+}
+
+// probeCapabilities checks the docker, gpio and camera capabilities by
+// actually exercising them rather than just checking that a binary/path
+// exists. All three are probed whether or not detectCapabilities()
+// advertised them; the other advertised capabilities are not probed.
+func probeCapabilities() []CapabilityProbe {
+	var probes []CapabilityProbe
+
+	if err := exec.Command("docker", "info").Run(); err != nil {
+		probes = append(probes, CapabilityProbe{Name: "docker", Ok: false, Detail: err.Error()})
+	} else {
+		probes = append(probes, CapabilityProbe{Name: "docker", Ok: true})
+	}
+
+	if f, err := os.OpenFile("/sys/class/gpio/export", os.O_WRONLY, 0); err != nil {
+		probes = append(probes, CapabilityProbe{Name: "gpio", Ok: false, Detail: err.Error()})
+	} else {
+		f.Close()
+		probes = append(probes, CapabilityProbe{Name: "gpio", Ok: true})
+	}
+
+	cameraOk, cameraDetail := false, "no camera device found"
+	for _, dev := range []string{"/dev/video0", "/dev/video1"} {
+		if f, err := os.OpenFile(dev, os.O_RDONLY, 0); err == nil {
+			f.Close()
+			cameraOk, cameraDetail = true, ""
+			break
+		} else {
+			cameraDetail = err.Error()
+		}
+	}
+	probes = append(probes, CapabilityProbe{Name: "camera", Ok: cameraOk, Detail: cameraDetail})
+
+	return probes
+}
+
+// ─── Local Status Endpoint ───────────────────────────────
+
+type statusResponse struct {
+	Node    NodeInfo `json:"node"`
+	SysInfo SysInfo  `json:"sysInfo"`
+	Health  Health   `json:"health"`
+}
+
+// serveStatus exposes the same health/sysinfo data sent to the gateway
+// over a local HTTP endpoint, so `forgeai-node status` and external
+// monitoring can scrape a node without a gateway round-trip.
+func serveStatus(addr string, a *Agent) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		resp := statusResponse{
+			Node:    a.nodeInfo,
+			SysInfo: collectSysInfo(),
+			Health:  a.buildHealth(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	log.Printf("[ForgeAI Node] Status endpoint listening on http://%s/status", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("[ForgeAI Node] Status endpoint failed: %v", err)
+	}
+}
+
+// runStatusCommand implements `forgeai-node status`, a thin client that
+// fetches --status-addr's JSON and prints it for a human at the console.
+func runStatusCommand(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	statusAddr := fs.String("status-addr", "127.0.0.1:9090", "Address of a running node's --status-addr endpoint")
+	fs.Parse(args)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/status", *statusAddr))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "forgeai-node status: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "forgeai-node status: %v\n", err)
+		os.Exit(1)
+	}
+
+	var pretty map[string]interface{}
+	if err := json.Unmarshal(body, &pretty); err != nil {
+		fmt.Println(string(body))
+		return
+	}
+	out, _ := json.MarshalIndent(pretty, "", "  ")
+	fmt.Println(string(out))
+}
@@ -1,30 +1,39 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/ed25519"
 	"flag"
 	"fmt"
 	"log"
 	"math/rand"
-	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	psnet "github.com/shirou/gopsutil/v3/net"
 )
 
 const (
-	Version          = "0.1.0"
-	HeartbeatInterval = 25 * time.Second
-	ReconnectBase    = 2 * time.Second
-	ReconnectMax     = 60 * time.Second
-	SysInfoInterval  = 60 * time.Second
+	Version            = "0.1.0"
+	HeartbeatInterval  = 25 * time.Second
+	ReconnectBase      = 2 * time.Second
+	ReconnectMax       = 60 * time.Second
+	SysInfoInterval    = 60 * time.Second
+	MetricsInterval    = 30 * time.Second
+	TopNProcesses      = 10
+	HealthInterval     = 60 * time.Second
+	CommandHistorySize = 20
 )
 
 // ─── Protocol Messages ───────────────────────────────────
@@ -47,7 +56,7 @@ type Message struct {
 	Stderr       string                 `json:"stderr,omitempty"`
 	DurationMs   int64                  `json:"durationMs,omitempty"`
 	Name         string                 `json:"name,omitempty"`
-	Data         map[string]interface{} `json:"data,omitempty"`
+	Data         string                 `json:"data,omitempty"`
 	Info         *SysInfo               `json:"info,omitempty"`
 	FromNodeId   string                 `json:"fromNodeId,omitempty"`
 	TargetNodeId string                 `json:"targetNodeId,omitempty"`
@@ -55,6 +64,20 @@ type Message struct {
 	Nodes        []NodeSummary          `json:"nodes,omitempty"`
 	Code         string                 `json:"code,omitempty"`
 	Message      string                 `json:"message,omitempty"`
+	Metrics      *Metrics               `json:"metrics,omitempty"`
+	Pid          int                    `json:"pid,omitempty"`
+	Signal       string                 `json:"signal,omitempty"`
+	ContainerId  string                 `json:"containerId,omitempty"`
+	Action       string                 `json:"action,omitempty"`
+	StreamId     string                 `json:"streamId,omitempty"`
+	Proto        string                 `json:"proto,omitempty"`
+	DstAddr      string                 `json:"dstAddr,omitempty"`
+	Seq          int64                  `json:"seq,omitempty"`
+	Bytes        int64                  `json:"bytes,omitempty"`
+	Health       *Health                `json:"health,omitempty"`
+	Signature    string                 `json:"signature,omitempty"`
+	Stream       string                 `json:"stream,omitempty"`
+	Chunk        string                 `json:"chunk,omitempty"`
 }
 
 type NodeInfo struct {
@@ -67,15 +90,20 @@ type NodeInfo struct {
 }
 
 type SysInfo struct {
-	CpuPercent    float64 `json:"cpuPercent"`
-	MemTotalMB    float64 `json:"memTotalMB"`
-	MemUsedMB     float64 `json:"memUsedMB"`
-	DiskTotalGB   float64 `json:"diskTotalGB"`
-	DiskUsedGB    float64 `json:"diskUsedGB"`
-	TempCelsius   float64 `json:"tempCelsius,omitempty"`
-	UptimeSeconds int64   `json:"uptimeSeconds"`
-	Hostname      string  `json:"hostname"`
-	IpAddress     string  `json:"ipAddress"`
+	CpuPercent    float64            `json:"cpuPercent"`
+	NCpus         int                `json:"nCpus"`
+	Load1         float64            `json:"load1"`
+	Load5         float64            `json:"load5"`
+	Load15        float64            `json:"load15"`
+	MemTotalMB    float64            `json:"memTotalMB"`
+	MemUsedMB     float64            `json:"memUsedMB"`
+	DiskTotalGB   float64            `json:"diskTotalGB"`
+	DiskUsedGB    float64            `json:"diskUsedGB"`
+	TempCelsius   float64            `json:"tempCelsius,omitempty"`
+	Sensors       map[string]float64 `json:"sensors,omitempty"`
+	UptimeSeconds int64              `json:"uptimeSeconds"`
+	Hostname      string             `json:"hostname"`
+	IpAddress     string             `json:"ipAddress"`
 }
 
 type NodeSummary struct {
@@ -91,19 +119,41 @@ type Agent struct {
 	gatewayURL string
 	token      string
 	nodeInfo   NodeInfo
-	conn       *websocket.Conn
+	transport  Transport
 	mu         sync.Mutex
 	done       chan struct{}
 	sessionId  string
+	relayMux   *RelayMux
+
+	reconnectAttempts int32
+	wsReadErrors      int64
+	wsWriteErrors     int64
+	lastAuthAt        int64
+	lastPingAtNano    int64 // unix nanoseconds; atomic, time.Time isn't
+	rttMs             int64
+
+	cmdHistoryMu sync.Mutex
+	cmdHistory   []CommandHistoryEntry
+
+	trustKeys []ed25519.PublicKey
+	policy    *Policy
+
+	seenMu     sync.Mutex
+	seenMsgIds map[string]int64 // msgId -> unix ms seen, for replay rejection
 }
 
-func NewAgent(gatewayURL, token string, nodeInfo NodeInfo) *Agent {
-	return &Agent{
+func NewAgent(gatewayURL, token string, nodeInfo NodeInfo, relayAllow []string, trustKeys []ed25519.PublicKey, policy *Policy) *Agent {
+	a := &Agent{
 		gatewayURL: gatewayURL,
 		token:      token,
 		nodeInfo:   nodeInfo,
 		done:       make(chan struct{}),
+		trustKeys:  trustKeys,
+		policy:     policy,
+		seenMsgIds: make(map[string]int64),
 	}
+	a.relayMux = NewRelayMux(a, relayAllow)
+	return a
 }
 
 func (a *Agent) Run() {
@@ -117,10 +167,8 @@ func (a *Agent) Run() {
 	close(a.done)
 
 	a.mu.Lock()
-	if a.conn != nil {
-		a.conn.WriteMessage(websocket.CloseMessage,
-			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "shutdown"))
-		a.conn.Close()
+	if a.transport != nil {
+		a.transport.Close()
 	}
 	a.mu.Unlock()
 }
@@ -153,6 +201,7 @@ func (a *Agent) connectLoop() {
 		if err != nil {
 			log.Printf("[ForgeAI Node] Connection failed: %v", err)
 			attempt++
+			atomic.AddInt32(&a.reconnectAttempts, 1)
 			continue
 		}
 
@@ -162,29 +211,17 @@ func (a *Agent) connectLoop() {
 }
 
 func (a *Agent) connect() error {
-	u, err := url.Parse(a.gatewayURL)
+	transport, err := newTransport(a.gatewayURL, a.nodeInfo.NodeId)
 	if err != nil {
 		return fmt.Errorf("invalid gateway URL: %w", err)
 	}
 
-	// Convert http(s) to ws(s)
-	switch u.Scheme {
-	case "http":
-		u.Scheme = "ws"
-	case "https":
-		u.Scheme = "wss"
-	}
-	u.Path = "/ws/node"
-
-	log.Printf("[ForgeAI Node] Connecting to %s ...", u.String())
-
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
-	if err != nil {
-		return fmt.Errorf("websocket dial: %w", err)
+	if err := transport.Dial(); err != nil {
+		return err
 	}
 
 	a.mu.Lock()
-	a.conn = conn
+	a.transport = transport
 	a.mu.Unlock()
 
 	// Send auth
@@ -195,36 +232,59 @@ func (a *Agent) connect() error {
 		Node:  &a.nodeInfo,
 	}
 	if err := a.send(authMsg); err != nil {
-		conn.Close()
+		transport.Close()
 		return fmt.Errorf("send auth: %w", err)
 	}
 
 	// Wait for auth response (5s timeout)
-	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-	var resp Message
-	if err := conn.ReadJSON(&resp); err != nil {
-		conn.Close()
+	resp, err := a.recvWithTimeout(5 * time.Second)
+	if err != nil {
+		transport.Close()
 		return fmt.Errorf("read auth response: %w", err)
 	}
-	conn.SetReadDeadline(time.Time{}) // clear deadline
 
 	if resp.Type == "auth_error" {
-		conn.Close()
+		transport.Close()
 		return fmt.Errorf("auth rejected: %s", resp.Reason)
 	}
 
 	if resp.Type == "auth_ok" {
 		a.sessionId = resp.SessionId
+		atomic.StoreInt64(&a.lastAuthAt, nowMs())
 		log.Printf("[ForgeAI Node] ✓ Authenticated (session: %s)", resp.SessionId)
 	}
 
 	// Start heartbeat + sysinfo goroutines
 	go a.heartbeatLoop()
 	go a.sysInfoLoop()
+	go a.metricsLoop()
+	go a.healthLoop()
 
 	return nil
 }
 
+// recvWithTimeout waits up to d for the transport's next message,
+// used only for the synchronous auth handshake in connect() — readLoop
+// itself blocks on Recv() directly once the connection is established.
+func (a *Agent) recvWithTimeout(d time.Duration) (Message, error) {
+	type result struct {
+		msg Message
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		msg, err := a.transport.Recv()
+		ch <- result{msg, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.msg, r.err
+	case <-time.After(d):
+		return Message{}, fmt.Errorf("timed out waiting for response")
+	}
+}
+
 func (a *Agent) readLoop() {
 	for {
 		select {
@@ -233,27 +293,43 @@ func (a *Agent) readLoop() {
 		default:
 		}
 
-		var msg Message
 		a.mu.Lock()
-		conn := a.conn
+		transport := a.transport
 		a.mu.Unlock()
 
-		if conn == nil {
+		if transport == nil {
 			return
 		}
 
-		if err := conn.ReadJSON(&msg); err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-				log.Printf("[ForgeAI Node] Connection lost: %v", err)
-			}
+		msg, err := transport.Recv()
+		if err != nil {
+			atomic.AddInt64(&a.wsReadErrors, 1)
+			log.Printf("[ForgeAI Node] Connection lost: %v", err)
 			return
 		}
 
 		switch msg.Type {
 		case "pong":
-			// heartbeat ack — no action needed
+			pingAt := time.Unix(0, atomic.LoadInt64(&a.lastPingAtNano))
+			atomic.StoreInt64(&a.rttMs, time.Since(pingAt).Milliseconds())
+		case "health_check":
+			go a.sendHealth()
 		case "command":
 			go a.handleCommand(msg)
+		case "list_processes":
+			go a.handleListProcesses(msg)
+		case "kill_process":
+			go a.handleKillProcess(msg)
+		case "container_action":
+			go a.handleContainerAction(msg)
+		case "relay_open":
+			go a.relayMux.handleOpen(msg)
+		case "relay_data":
+			go a.relayMux.handleData(msg)
+		case "relay_close":
+			go a.relayMux.handleClose(msg)
+		case "relay_ack":
+			a.relayMux.handleAck(msg)
 		case "response":
 			log.Printf("[ForgeAI Node] AI Response: %s", truncate(msg.Content, 200))
 		case "relay":
@@ -272,75 +348,23 @@ func (a *Agent) readLoop() {
 }
 
 // ─── Command Execution ───────────────────────────────────
-
-func (a *Agent) handleCommand(msg Message) {
-	log.Printf("[ForgeAI Node] Executing command: %s %s", msg.Cmd, strings.Join(msg.Args, " "))
-	start := time.Now()
-
-	timeout := 30 * time.Second
-	if msg.Timeout > 0 {
-		timeout = time.Duration(msg.Timeout) * time.Millisecond
-	}
-
-	// Build command
-	var cmd *exec.Cmd
-	if len(msg.Args) > 0 {
-		cmd = exec.Command(msg.Cmd, msg.Args...)
-	} else {
-		// Shell execution
-		if runtime.GOOS == "windows" {
-			cmd = exec.Command("cmd", "/C", msg.Cmd)
-		} else {
-			cmd = exec.Command("sh", "-c", msg.Cmd)
-		}
-	}
-
-	// Set timeout via context would be better but this is simpler for Go 1.21
-	done := make(chan error, 1)
-	var stdout, stderr strings.Builder
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	go func() {
-		done <- cmd.Run()
-	}()
-
-	var exitCode int
-	select {
-	case err := <-done:
-		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				exitCode = exitErr.ExitCode()
-			} else {
-				exitCode = -1
-				stderr.WriteString(err.Error())
-			}
-		}
-	case <-time.After(timeout):
-		if cmd.Process != nil {
-			cmd.Process.Kill()
-		}
-		exitCode = -1
-		stderr.WriteString("command timed out")
-	}
-
-	duration := time.Since(start).Milliseconds()
-
-	result := Message{
-		Type:       "command_result",
-		Ts:         nowMs(),
-		MsgId:      msg.MsgId,
+//
+// handleCommand, signature verification and policy enforcement live in
+// command.go.
+
+// recordCommandHistory appends to the rolling window of recently
+// executed commands surfaced in health reports.
+func (a *Agent) recordCommandHistory(cmd string, exitCode int, durationMs int64) {
+	a.cmdHistoryMu.Lock()
+	defer a.cmdHistoryMu.Unlock()
+	a.cmdHistory = append(a.cmdHistory, CommandHistoryEntry{
+		Cmd:        cmd,
 		ExitCode:   exitCode,
-		Stdout:     truncate(stdout.String(), 50000),
-		Stderr:     truncate(stderr.String(), 10000),
-		DurationMs: duration,
-	}
-
-	if err := a.send(result); err != nil {
-		log.Printf("[ForgeAI Node] Failed to send command result: %v", err)
+		DurationMs: durationMs,
+	})
+	if len(a.cmdHistory) > CommandHistorySize {
+		a.cmdHistory = a.cmdHistory[len(a.cmdHistory)-CommandHistorySize:]
 	}
-
-	log.Printf("[ForgeAI Node] Command done (exit=%d, %dms)", exitCode, duration)
 }
 
 // ─── Heartbeat ───────────────────────────────────────────
@@ -354,6 +378,7 @@ func (a *Agent) heartbeatLoop() {
 		case <-a.done:
 			return
 		case <-ticker.C:
+			atomic.StoreInt64(&a.lastPingAtNano, time.Now().UnixNano())
 			ping := Message{Type: "ping", Ts: nowMs()}
 			if err := a.send(ping); err != nil {
 				log.Printf("[ForgeAI Node] Heartbeat send failed: %v", err)
@@ -394,75 +419,69 @@ func (a *Agent) sendSysInfo() {
 	}
 }
 
+// collectSysInfo gathers cross-platform metrics via gopsutil so nodes
+// running on macOS, Windows and *BSD report real data instead of an
+// empty SysInfo (the old implementation only understood /proc).
 func collectSysInfo() SysInfo {
-	hostname, _ := os.Hostname()
-
 	info := SysInfo{
-		Hostname:      hostname,
-		UptimeSeconds: getUptime(),
-		IpAddress:     getLocalIP(),
-	}
-
-	// Memory info (Linux)
-	if data, err := os.ReadFile("/proc/meminfo"); err == nil {
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			if strings.HasPrefix(line, "MemTotal:") {
-				fmt.Sscanf(line, "MemTotal: %f kB", &info.MemTotalMB)
-				info.MemTotalMB /= 1024
-			}
-			if strings.HasPrefix(line, "MemAvailable:") {
-				var avail float64
-				fmt.Sscanf(line, "MemAvailable: %f kB", &avail)
-				info.MemUsedMB = info.MemTotalMB - (avail / 1024)
-			}
-		}
+		NCpus:     runtime.NumCPU(),
+		IpAddress: getLocalIP(),
+		Sensors:   map[string]float64{},
 	}
 
-	// CPU usage (simplified — 1s sample)
-	if idle1, total1, err := readCPU(); err == nil {
-		time.Sleep(500 * time.Millisecond)
-		if idle2, total2, err := readCPU(); err == nil {
-			idleDelta := float64(idle2 - idle1)
-			totalDelta := float64(total2 - total1)
-			if totalDelta > 0 {
-				info.CpuPercent = (1.0 - idleDelta/totalDelta) * 100
-			}
-		}
+	if hi, err := host.Info(); err == nil {
+		info.Hostname = hi.Hostname
+		info.UptimeSeconds = int64(hi.Uptime)
+	} else {
+		info.Hostname, _ = os.Hostname()
+		info.UptimeSeconds = getUptime()
 	}
 
-	// Temperature (Raspberry Pi / Linux thermal)
-	if data, err := os.ReadFile("/sys/class/thermal/thermal_zone0/temp"); err == nil {
-		var millideg float64
-		fmt.Sscanf(strings.TrimSpace(string(data)), "%f", &millideg)
-		info.TempCelsius = millideg / 1000
+	if pct, err := cpu.Percent(500*time.Millisecond, false); err == nil && len(pct) > 0 {
+		info.CpuPercent = pct[0]
+	}
+
+	if vm, err := mem.VirtualMemory(); err == nil {
+		info.MemTotalMB = float64(vm.Total) / 1024 / 1024
+		info.MemUsedMB = float64(vm.Used) / 1024 / 1024
+	}
+
+	if du, err := disk.Usage(rootMount()); err == nil {
+		info.DiskTotalGB = float64(du.Total) / 1024 / 1024 / 1024
+		info.DiskUsedGB = float64(du.Used) / 1024 / 1024 / 1024
+	}
+
+	if avg, err := load.Avg(); err == nil {
+		info.Load1, info.Load5, info.Load15 = avg.Load1, avg.Load5, avg.Load15
+	}
+
+	// Sensors vary wildly across boards — a Pi reports one thermal zone,
+	// a server reports one per CPU package — so surface all of them
+	// keyed by sensor name instead of picking a single well-known path.
+	if temps, err := host.SensorsTemperatures(); err == nil {
+		for _, t := range temps {
+			info.Sensors[t.SensorKey] = t.Temperature
+		}
+		if v, ok := info.Sensors["thermal_zone0"]; ok {
+			info.TempCelsius = v
+		} else if len(temps) > 0 {
+			info.TempCelsius = temps[0].Temperature
+		}
+	}
+	if len(info.Sensors) == 0 {
+		info.Sensors = nil
 	}
 
 	return info
 }
 
-func readCPU() (idle, total int64, err error) {
-	data, err := os.ReadFile("/proc/stat")
-	if err != nil {
-		return 0, 0, err
-	}
-	lines := strings.Split(string(data), "\n")
-	if len(lines) == 0 {
-		return 0, 0, fmt.Errorf("empty /proc/stat")
-	}
-	fields := strings.Fields(lines[0])
-	if len(fields) < 5 {
-		return 0, 0, fmt.Errorf("unexpected /proc/stat format")
-	}
-	for i := 1; i < len(fields); i++ {
-		var v int64
-		fmt.Sscanf(fields[i], "%d", &v)
-		total += v
-		if i == 4 { // idle is 4th field
-			idle = v
-		}
+// rootMount returns the filesystem path disk.Usage should be sampled
+// against for the node's primary volume.
+func rootMount() string {
+	if runtime.GOOS == "windows" {
+		return `C:\`
 	}
-	return idle, total, nil
+	return "/"
 }
 
 func getUptime() int64 {
@@ -475,13 +494,20 @@ func getUptime() int64 {
 	return int64(uptime)
 }
 
+// getLocalIP returns the first non-loopback address found across all
+// interfaces, falling back to loopback if the node has nothing else up.
 func getLocalIP() string {
-	// Simple approach: try to read from hostname command
-	out, err := exec.Command("hostname", "-I").Output()
-	if err == nil {
-		parts := strings.Fields(string(out))
-		if len(parts) > 0 {
-			return parts[0]
+	ifaces, err := psnet.Interfaces()
+	if err != nil {
+		return "127.0.0.1"
+	}
+	for _, iface := range ifaces {
+		for _, addr := range iface.Addrs {
+			ip := strings.SplitN(addr.Addr, "/", 2)[0]
+			if ip == "" || ip == "127.0.0.1" || ip == "::1" {
+				continue
+			}
+			return ip
 		}
 	}
 	return "127.0.0.1"
@@ -491,15 +517,16 @@ func getLocalIP() string {
 
 func (a *Agent) send(msg Message) error {
 	a.mu.Lock()
-	defer a.mu.Unlock()
-	if a.conn == nil {
+	transport := a.transport
+	a.mu.Unlock()
+	if transport == nil {
 		return fmt.Errorf("not connected")
 	}
-	data, err := json.Marshal(msg)
-	if err != nil {
+	if err := transport.Send(msg); err != nil {
+		atomic.AddInt64(&a.wsWriteErrors, 1)
 		return err
 	}
-	return a.conn.WriteMessage(websocket.TextMessage, data)
+	return nil
 }
 
 func nowMs() int64 {
@@ -525,7 +552,7 @@ func getPlatform() string {
 }
 
 func detectCapabilities() []string {
-	caps := []string{"shell", "system"}
+	caps := []string{"shell", "system", "metrics"}
 
 	if runtime.GOOS == "linux" {
 		// Check for GPIO (Raspberry Pi)
@@ -554,11 +581,20 @@ func detectCapabilities() []string {
 // ─── Main ────────────────────────────────────────────────
 
 func main() {
-	gateway := flag.String("gateway", "", "Gateway URL (e.g. http://localhost:18800)")
+	if len(os.Args) > 1 && os.Args[1] == "status" {
+		runStatusCommand(os.Args[2:])
+		return
+	}
+
+	gateway := flag.String("gateway", "", "Gateway URL — ws(s):// for the ForgeAI gateway, nats:// or mqtt(s):// to join an existing broker fleet (e.g. http://localhost:18800)")
 	token := flag.String("token", "", "API key for authentication")
 	nodeId := flag.String("id", "", "Unique node ID (auto-generated if empty)")
 	nodeName := flag.String("name", "", "Node display name")
 	tagsStr := flag.String("tags", "", "Comma-separated tags (e.g. office,floor2)")
+	relayAllowStr := flag.String("relay-allow", "", "Comma-separated host:port allowlist for relay_open targets")
+	statusAddr := flag.String("status-addr", "", "Serve local JSON health/sysinfo status on this address (e.g. 127.0.0.1:9090)")
+	trustKeysStr := flag.String("trust-keys", "", "Comma-separated base64 Ed25519 public keys trusted to sign command messages")
+	policyPath := flag.String("policy", "", "Path to a YAML/JSON command policy file")
 	flag.Parse()
 
 	// Env var fallbacks
@@ -574,9 +610,12 @@ func main() {
 	if *nodeName == "" {
 		*nodeName = os.Getenv("FORGEAI_NODE_NAME")
 	}
+	if *trustKeysStr == "" {
+		*trustKeysStr = os.Getenv("FORGEAI_TRUST_KEYS")
+	}
 
 	if *gateway == "" || *token == "" {
-		fmt.Println(`
+		fmt.Print(`
 ╔═══════════════════════════════════════════╗
 ║         ForgeAI Node Agent v` + Version + `        ║
 ╚═══════════════════════════════════════════╝
@@ -585,15 +624,22 @@ Usage:
   forgeai-node --gateway <URL> --token <KEY> [options]
 
 Options:
-  --gateway   Gateway URL (or env FORGEAI_GATEWAY)
+  --gateway   Gateway URL (or env FORGEAI_GATEWAY) — ws(s)://, nats:// or mqtt(s)://
   --token     API key (or env FORGEAI_NODE_TOKEN)
   --id        Node ID (or env FORGEAI_NODE_ID, auto if empty)
   --name      Display name (or env FORGEAI_NODE_NAME)
   --tags      Comma-separated tags
+  --relay-allow  Comma-separated host:port allowlist for relay_open targets
+  --status-addr  Serve local JSON health/sysinfo status (e.g. 127.0.0.1:9090)
+  --trust-keys   Comma-separated base64 Ed25519 public keys (or env FORGEAI_TRUST_KEYS)
+  --policy       Path to a YAML/JSON command policy file
 
 Examples:
   forgeai-node --gateway http://192.168.1.100:18800 --token mykey123 --name "RaspberryPi-Office"
   FORGEAI_GATEWAY=http://gw:18800 FORGEAI_NODE_TOKEN=key forgeai-node
+  forgeai-node --gateway nats://nats.example.com:4222 --token mykey123
+  forgeai-node --gateway mqtts://broker.example.com:8883 --token mykey123
+  forgeai-node status --status-addr 127.0.0.1:9090
 `)
 		os.Exit(1)
 	}
@@ -613,6 +659,31 @@ Examples:
 		tags = strings.Split(*tagsStr, ",")
 	}
 
+	var trustKeys []ed25519.PublicKey
+	if *trustKeysStr != "" {
+		keys, err := parseTrustKeys(*trustKeysStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "forgeai-node: --trust-keys: %v\n", err)
+			os.Exit(1)
+		}
+		trustKeys = keys
+	}
+
+	var policy *Policy
+	if *policyPath != "" {
+		p, err := loadPolicy(*policyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "forgeai-node: --policy: %v\n", err)
+			os.Exit(1)
+		}
+		policy = p
+	}
+
+	var relayAllow []string
+	if *relayAllowStr != "" {
+		relayAllow = strings.Split(*relayAllowStr, ",")
+	}
+
 	nodeInfo := NodeInfo{
 		NodeId:       *nodeId,
 		Name:         *nodeName,
@@ -635,6 +706,9 @@ Examples:
 `, Version, nodeInfo.NodeId, nodeInfo.Name, nodeInfo.Platform,
 		strings.Join(nodeInfo.Capabilities, ","), *gateway)
 
-	agent := NewAgent(*gateway, *token, nodeInfo)
+	agent := NewAgent(*gateway, *token, nodeInfo, relayAllow, trustKeys, policy)
+	if *statusAddr != "" {
+		go serveStatus(*statusAddr, agent)
+	}
 	agent.Run()
 }
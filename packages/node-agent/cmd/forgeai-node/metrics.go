@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os/exec"
+	"sort"
+	"syscall"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ─── Metrics ─────────────────────────────────────────────
+
+type ProcessInfo struct {
+	Pid        int32   `json:"pid"`
+	Name       string  `json:"name"`
+	CpuPercent float64 `json:"cpuPercent"`
+	RssMB      float64 `json:"rssMB"`
+	User       string  `json:"user"`
+}
+
+type NetIOCounter struct {
+	Interface string `json:"interface"`
+	BytesSent uint64 `json:"bytesSent"`
+	BytesRecv uint64 `json:"bytesRecv"`
+}
+
+type ContainerStats struct {
+	Id         string  `json:"id"`
+	Name       string  `json:"name"`
+	CpuPercent float64 `json:"cpuPercent"`
+	MemUsedMB  float64 `json:"memUsedMB"`
+	NetRxMB    float64 `json:"netRxMB"`
+	NetTxMB    float64 `json:"netTxMB"`
+}
+
+type Metrics struct {
+	Processes  []ProcessInfo    `json:"processes"`
+	NetIO      []NetIOCounter   `json:"netIO"`
+	Containers []ContainerStats `json:"containers,omitempty"`
+}
+
+func (a *Agent) metricsLoop() {
+	ticker := time.NewTicker(MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.sendMetrics()
+		}
+	}
+}
+
+func (a *Agent) sendMetrics() {
+	m := Metrics{
+		Processes: topProcesses(TopNProcesses),
+		NetIO:     netIOCounters(),
+	}
+	if dockerAvailable() {
+		if stats, err := dockerContainerStats(); err == nil {
+			m.Containers = stats
+		} else {
+			log.Printf("[ForgeAI Node] docker stats failed: %v", err)
+		}
+	}
+
+	msg := Message{Type: "metrics", Ts: nowMs(), Metrics: &m}
+	if err := a.send(msg); err != nil {
+		log.Printf("[ForgeAI Node] Failed to send metrics: %v", err)
+	}
+}
+
+// topProcesses returns the n processes with the highest CPU usage, as
+// reported by gopsutil's CPUPercent: each process's average usage since
+// it started, not a sample over a recent window.
+func topProcesses(n int) []ProcessInfo {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil
+	}
+
+	infos := make([]ProcessInfo, 0, len(procs))
+	for _, p := range procs {
+		cpuPct, err := p.CPUPercent()
+		if err != nil {
+			continue
+		}
+		name, _ := p.Name()
+		user, _ := p.Username()
+		var rssMB float64
+		if mi, err := p.MemoryInfo(); err == nil && mi != nil {
+			rssMB = float64(mi.RSS) / 1024 / 1024
+		}
+		infos = append(infos, ProcessInfo{
+			Pid:        p.Pid,
+			Name:       name,
+			CpuPercent: cpuPct,
+			RssMB:      rssMB,
+			User:       user,
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].CpuPercent > infos[j].CpuPercent })
+	if len(infos) > n {
+		infos = infos[:n]
+	}
+	return infos
+}
+
+func netIOCounters() []NetIOCounter {
+	counters, err := psnet.IOCounters(true)
+	if err != nil {
+		return nil
+	}
+	out := make([]NetIOCounter, 0, len(counters))
+	for _, c := range counters {
+		out = append(out, NetIOCounter{
+			Interface: c.Name,
+			BytesSent: c.BytesSent,
+			BytesRecv: c.BytesRecv,
+		})
+	}
+	return out
+}
+
+func dockerAvailable() bool {
+	_, err := exec.LookPath("docker")
+	return err == nil
+}
+
+// ─── Process / Container Commands ───────────────────────
+
+func (a *Agent) handleListProcesses(msg Message) {
+	if reason := a.authorizeCommand(msg); reason != "" {
+		log.Printf("[ForgeAI Node] Rejecting list_processes: %s", reason)
+		a.rejectCommand(msg, reason)
+		return
+	}
+
+	result := Message{
+		Type:    "processes",
+		Ts:      nowMs(),
+		MsgId:   msg.MsgId,
+		Metrics: &Metrics{Processes: topProcesses(TopNProcesses)},
+	}
+	if err := a.send(result); err != nil {
+		log.Printf("[ForgeAI Node] Failed to send process list: %v", err)
+	}
+}
+
+func (a *Agent) handleKillProcess(msg Message) {
+	if reason := a.authorizeCommand(msg); reason != "" {
+		log.Printf("[ForgeAI Node] Rejecting kill_process: %s", reason)
+		a.rejectCommand(msg, reason)
+		return
+	}
+
+	result := Message{Type: "command_result", Ts: nowMs(), MsgId: msg.MsgId}
+
+	sig, sigName := syscall.SIGTERM, "SIGTERM"
+	if msg.Signal == "SIGKILL" {
+		sig, sigName = syscall.SIGKILL, "SIGKILL"
+	}
+
+	proc, err := process.NewProcess(int32(msg.Pid))
+	if err != nil {
+		result.ExitCode = -1
+		result.Stderr = fmt.Sprintf("process %d not found: %v", msg.Pid, err)
+	} else if err := proc.SendSignal(sig); err != nil {
+		result.ExitCode = -1
+		result.Stderr = fmt.Sprintf("signal %d to pid %d failed: %v", sig, msg.Pid, err)
+	} else {
+		result.Stdout = fmt.Sprintf("sent %s to pid %d", sigName, msg.Pid)
+	}
+
+	if err := a.send(result); err != nil {
+		log.Printf("[ForgeAI Node] Failed to send kill_process result: %v", err)
+	}
+}
+
+// allowedContainerActions bounds container_action to lifecycle
+// operations on a container the caller already named — not arbitrary
+// docker subcommands. "run" would start a brand new container from
+// ContainerId as an image ref, and "exec"/"system" reach well beyond
+// "drill into a node", so none of those are in this list.
+var allowedContainerActions = map[string]bool{
+	"start":   true,
+	"stop":    true,
+	"restart": true,
+	"pause":   true,
+	"unpause": true,
+	"kill":    true,
+}
+
+func (a *Agent) handleContainerAction(msg Message) {
+	if reason := a.authorizeCommand(msg); reason != "" {
+		log.Printf("[ForgeAI Node] Rejecting container_action: %s", reason)
+		a.rejectCommand(msg, reason)
+		return
+	}
+
+	result := Message{Type: "command_result", Ts: nowMs(), MsgId: msg.MsgId}
+
+	if !allowedContainerActions[msg.Action] {
+		result.ExitCode = -1
+		result.Stderr = fmt.Sprintf("container action %q is not allowed", msg.Action)
+	} else if !dockerAvailable() {
+		result.ExitCode = -1
+		result.Stderr = "docker not available on this node"
+	} else {
+		out, err := exec.Command("docker", msg.Action, msg.ContainerId).CombinedOutput()
+		result.Stdout = string(out)
+		if err != nil {
+			result.ExitCode = -1
+			result.Stderr = err.Error()
+		}
+	}
+
+	if err := a.send(result); err != nil {
+		log.Printf("[ForgeAI Node] Failed to send container_action result: %v", err)
+	}
+}
+
+// ─── Docker Engine API (unix socket) ─────────────────────
+
+const dockerSocket = "/var/run/docker.sock"
+
+var dockerHTTPClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", dockerSocket)
+		},
+	},
+}
+
+// dockerContainerStats queries the Docker Engine API over its unix
+// socket for running containers and their (non-streamed) resource usage.
+func dockerContainerStats() ([]ContainerStats, error) {
+	type containerSummary struct {
+		Id    string   `json:"Id"`
+		Names []string `json:"Names"`
+	}
+	var summaries []containerSummary
+	if err := dockerGet("/containers/json", &summaries); err != nil {
+		return nil, err
+	}
+
+	stats := make([]ContainerStats, 0, len(summaries))
+	for _, c := range summaries {
+		var raw struct {
+			CPUStats struct {
+				CPUUsage struct {
+					TotalUsage  uint64   `json:"total_usage"`
+					PercpuUsage []uint64 `json:"percpu_usage"`
+				} `json:"cpu_usage"`
+				SystemUsage uint64 `json:"system_cpu_usage"`
+				OnlineCPUs  uint64 `json:"online_cpus"`
+			} `json:"cpu_stats"`
+			PreCPUStats struct {
+				CPUUsage struct {
+					TotalUsage uint64 `json:"total_usage"`
+				} `json:"cpu_usage"`
+				SystemUsage uint64 `json:"system_cpu_usage"`
+			} `json:"precpu_stats"`
+			MemoryStats struct {
+				Usage uint64 `json:"usage"`
+			} `json:"memory_stats"`
+			Networks map[string]struct {
+				RxBytes uint64 `json:"rx_bytes"`
+				TxBytes uint64 `json:"tx_bytes"`
+			} `json:"networks"`
+		}
+		if err := dockerGet(fmt.Sprintf("/containers/%s/stats?stream=false", c.Id), &raw); err != nil {
+			continue
+		}
+
+		// Docker's own "online CPUs" isn't always populated, depending on
+		// the cgroup driver; percpu_usage's length is the same number
+		// when present, and falls back to 1 only if neither is (matches
+		// `docker stats`' CPU % formula).
+		onlineCPUs := raw.CPUStats.OnlineCPUs
+		if onlineCPUs == 0 {
+			onlineCPUs = uint64(len(raw.CPUStats.CPUUsage.PercpuUsage))
+		}
+		if onlineCPUs == 0 {
+			onlineCPUs = 1
+		}
+
+		var cpuPct float64
+		cpuDelta := float64(raw.CPUStats.CPUUsage.TotalUsage) - float64(raw.PreCPUStats.CPUUsage.TotalUsage)
+		sysDelta := float64(raw.CPUStats.SystemUsage) - float64(raw.PreCPUStats.SystemUsage)
+		if sysDelta > 0 {
+			cpuPct = (cpuDelta / sysDelta) * float64(onlineCPUs) * 100
+		}
+
+		var rxMB, txMB float64
+		for _, n := range raw.Networks {
+			rxMB += float64(n.RxBytes) / 1024 / 1024
+			txMB += float64(n.TxBytes) / 1024 / 1024
+		}
+
+		name := c.Id
+		if len(c.Names) > 0 {
+			name = c.Names[0]
+		}
+		stats = append(stats, ContainerStats{
+			Id:         c.Id,
+			Name:       name,
+			CpuPercent: cpuPct,
+			MemUsedMB:  float64(raw.MemoryStats.Usage) / 1024 / 1024,
+			NetRxMB:    rxMB,
+			NetTxMB:    txMB,
+		})
+	}
+	return stats, nil
+}
+
+func dockerGet(path string, out interface{}) error {
+	resp, err := dockerHTTPClient.Get("http://unix" + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("docker API %s: %s", path, resp.Status)
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// ─── MQTT Transport ──────────────────────────────────────
+//
+// Selected by an mqtt:// or mqtts:// gateway URL. Commands arrive on
+// forgeai/nodes/<id>/cmd; everything the node emits is published to
+// forgeai/nodes/<id>/evt, except sysinfo which gets its own
+// forgeai/nodes/<id>/sysinfo topic since it's high-volume and most
+// broker-side consumers only want the event stream. The connection's
+// Last Will publishes an "offline" event to the evt topic, so the
+// gateway notices a dead node immediately instead of waiting out a
+// missed heartbeat.
+
+type mqttTransport struct {
+	broker    string
+	nodeId    string
+	client    mqtt.Client
+	msgCh     chan Message
+	closeOnce sync.Once
+}
+
+func newMQTTTransport(gatewayURL, nodeId string) *mqttTransport {
+	return &mqttTransport{
+		broker: gatewayURL,
+		nodeId: nodeId,
+		msgCh:  make(chan Message, 64),
+	}
+}
+
+func (t *mqttTransport) cmdTopic() string     { return fmt.Sprintf("forgeai/nodes/%s/cmd", t.nodeId) }
+func (t *mqttTransport) evtTopic() string     { return fmt.Sprintf("forgeai/nodes/%s/evt", t.nodeId) }
+func (t *mqttTransport) sysinfoTopic() string { return fmt.Sprintf("forgeai/nodes/%s/sysinfo", t.nodeId) }
+
+func (t *mqttTransport) Dial() error {
+	lwt, _ := json.Marshal(Message{Type: "offline", Ts: nowMs()})
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(t.broker).
+		SetClientID("forgeai-node-" + t.nodeId).
+		SetWill(t.evtTopic(), string(lwt), 1, false).
+		SetAutoReconnect(false).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("[ForgeAI Node] mqtt connection lost: %v", err)
+			t.closeMsgCh()
+		})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("mqtt connect: %w", token.Error())
+	}
+
+	handler := func(_ mqtt.Client, m mqtt.Message) {
+		var msg Message
+		if err := json.Unmarshal(m.Payload(), &msg); err != nil {
+			log.Printf("[ForgeAI Node] mqtt decode failed: %v", err)
+			return
+		}
+		t.msgCh <- msg
+	}
+	if token := client.Subscribe(t.cmdTopic(), 1, handler); token.Wait() && token.Error() != nil {
+		client.Disconnect(250)
+		return fmt.Errorf("mqtt subscribe: %w", token.Error())
+	}
+
+	t.client = client
+	log.Printf("[ForgeAI Node] Connected to MQTT broker %s (cmd=%s)", t.broker, t.cmdTopic())
+	return nil
+}
+
+func (t *mqttTransport) Send(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	topic := t.evtTopic()
+	if msg.Type == "sysinfo" {
+		topic = t.sysinfoTopic()
+	}
+
+	token := t.client.Publish(topic, 1, false, data)
+	token.Wait()
+	return token.Error()
+}
+
+func (t *mqttTransport) Recv() (Message, error) {
+	msg, ok := <-t.msgCh
+	if !ok {
+		return Message{}, fmt.Errorf("mqtt client disconnected")
+	}
+	return msg, nil
+}
+
+// closeMsgCh unblocks any pending Recv, from either a broker-initiated
+// disconnect (ConnectionLostHandler) or an agent-initiated Close. Once
+// guards against both firing for the same disconnect.
+func (t *mqttTransport) closeMsgCh() {
+	t.closeOnce.Do(func() { close(t.msgCh) })
+}
+
+func (t *mqttTransport) Close() error {
+	if t.client != nil {
+		t.client.Disconnect(250)
+	}
+	t.closeMsgCh()
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ─── NATS Transport ──────────────────────────────────────
+//
+// Selected by a nats:// gateway URL. A node publishes everything it
+// emits (auth, sysinfo, health, command_result, ...) on
+// forgeai.node.<id>.tx and subscribes to forgeai.node.<id>.rx for
+// commands from the gateway. The rx subscription runs through
+// JetStream so a command published while the node is briefly
+// disconnected is still delivered on reconnect, instead of being lost
+// the way it would be over a plain WebSocket.
+
+type natsTransport struct {
+	url    string
+	nodeId string
+	nc     *nats.Conn
+	sub    *nats.Subscription
+	msgCh  chan *nats.Msg
+}
+
+func newNATSTransport(gatewayURL, nodeId string) *natsTransport {
+	return &natsTransport{
+		url:    gatewayURL,
+		nodeId: nodeId,
+		msgCh:  make(chan *nats.Msg, 64),
+	}
+}
+
+func (t *natsTransport) rxSubject() string { return fmt.Sprintf("forgeai.node.%s.rx", t.nodeId) }
+func (t *natsTransport) txSubject() string { return fmt.Sprintf("forgeai.node.%s.tx", t.nodeId) }
+
+func (t *natsTransport) Dial() error {
+	nc, err := nats.Connect(t.url)
+	if err != nil {
+		return fmt.Errorf("nats connect: %w", err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("nats jetstream: %w", err)
+	}
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     "FORGEAI_NODE_" + t.nodeId,
+		Subjects: []string{t.rxSubject()},
+	})
+	if err != nil && err != nats.ErrStreamNameAlreadyInUse {
+		nc.Close()
+		return fmt.Errorf("nats add stream: %w", err)
+	}
+
+	sub, err := js.ChanSubscribe(t.rxSubject(), t.msgCh,
+		nats.Durable("forgeai-node-"+t.nodeId), nats.ManualAck())
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("nats subscribe: %w", err)
+	}
+
+	t.nc = nc
+	t.sub = sub
+	log.Printf("[ForgeAI Node] Connected to NATS at %s (rx=%s tx=%s)", t.url, t.rxSubject(), t.txSubject())
+	return nil
+}
+
+func (t *natsTransport) Send(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return t.nc.Publish(t.txSubject(), data)
+}
+
+func (t *natsTransport) Recv() (Message, error) {
+	m, ok := <-t.msgCh
+	if !ok {
+		return Message{}, fmt.Errorf("nats subscription closed")
+	}
+	m.Ack()
+
+	var msg Message
+	if err := json.Unmarshal(m.Data, &msg); err != nil {
+		return Message{}, fmt.Errorf("nats decode: %w", err)
+	}
+	return msg, nil
+}
+
+func (t *natsTransport) Close() error {
+	if t.sub != nil {
+		t.sub.Unsubscribe()
+	}
+	if t.nc != nil {
+		t.nc.Close()
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/base64"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ─── Relay Tunnels ───────────────────────────────────────
+//
+// RelayMux multiplexes node-to-node byte streams over the single
+// gateway websocket connection, the same way NetBird's relay server
+// lets a node reach another without either side opening inbound ports.
+// The gateway brokers relay_open/relay_close between two nodes; once a
+// stream is open, relay_data frames carry the actual payload.
+
+const (
+	relayWindowSize   = 256 * 1024 // sliding window of unacked bytes per stream
+	relayReadBufSize  = 32 * 1024
+	relayGlobalBudget = 4 * 1024 * 1024 // bytes/sec across all streams
+	relayStreamBudget = 1 * 1024 * 1024 // bytes/sec per stream
+)
+
+type relayStream struct {
+	id       string
+	proto    string
+	conn     net.Conn
+	limiter  *tokenBucket
+	unacked  int64
+	mu       sync.Mutex
+	closedCh chan struct{}
+}
+
+type RelayMux struct {
+	agent   *Agent
+	allow   []string
+	global  *tokenBucket
+	mu      sync.Mutex
+	streams map[string]*relayStream
+}
+
+func NewRelayMux(agent *Agent, allow []string) *RelayMux {
+	return &RelayMux{
+		agent:   agent,
+		allow:   allow,
+		global:  newTokenBucket(relayGlobalBudget),
+		streams: make(map[string]*relayStream),
+	}
+}
+
+func (r *RelayMux) allowed(addr string) bool {
+	if len(r.allow) == 0 {
+		return false
+	}
+	for _, a := range r.allow {
+		if strings.TrimSpace(a) == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RelayMux) handleOpen(msg Message) {
+	if !r.allowed(msg.DstAddr) {
+		r.sendClose(msg.StreamId, "destination not in --relay-allow allowlist")
+		return
+	}
+
+	network := msg.Proto
+	if network == "" {
+		network = "tcp"
+	}
+
+	conn, err := net.DialTimeout(network, msg.DstAddr, 10*time.Second)
+	if err != nil {
+		log.Printf("[ForgeAI Node] relay_open dial %s failed: %v", msg.DstAddr, err)
+		r.sendClose(msg.StreamId, "dial failed: "+err.Error())
+		return
+	}
+
+	stream := &relayStream{
+		id:       msg.StreamId,
+		proto:    network,
+		conn:     conn,
+		limiter:  newTokenBucket(relayStreamBudget),
+		closedCh: make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	r.streams[stream.id] = stream
+	r.mu.Unlock()
+
+	go r.pump(stream)
+}
+
+// pump reads from the dialed connection and forwards it upstream as
+// relay_data frames, applying the global and per-stream rate limits.
+func (r *RelayMux) pump(s *relayStream) {
+	defer r.closeStream(s.id, "eof")
+
+	buf := make([]byte, relayReadBufSize)
+	var seq int64
+	for {
+		n, err := s.conn.Read(buf)
+		if n > 0 {
+			r.global.take(int64(n))
+			s.limiter.take(int64(n))
+
+			seq++
+			data := Message{
+				Type:     "relay_data",
+				Ts:       nowMs(),
+				StreamId: s.id,
+				Seq:      seq,
+				Data:     base64.StdEncoding.EncodeToString(buf[:n]),
+			}
+			if sendErr := r.agent.send(data); sendErr != nil {
+				log.Printf("[ForgeAI Node] relay_data send failed: %v", sendErr)
+				return
+			}
+
+			s.mu.Lock()
+			s.unacked += int64(n)
+			blocked := s.unacked > relayWindowSize
+			s.mu.Unlock()
+			if blocked {
+				// Simple flow control: stall reads until the peer acks
+				// enough bytes to bring the window back under budget.
+				for blocked {
+					select {
+					case <-time.After(50 * time.Millisecond):
+					case <-s.closedCh:
+						return
+					}
+					s.mu.Lock()
+					blocked = s.unacked > relayWindowSize
+					s.mu.Unlock()
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handleData applies the same global and per-stream rate limits to the
+// inbound direction as pump() applies outbound, so a peer can't flood a
+// node through its own tunnel just because the flood arrives as
+// relay_data instead of raw socket traffic.
+func (r *RelayMux) handleData(msg Message) {
+	r.mu.Lock()
+	s, ok := r.streams[msg.StreamId]
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(msg.Data)
+	if err != nil {
+		return
+	}
+
+	r.global.take(int64(len(raw)))
+	s.limiter.take(int64(len(raw)))
+
+	if _, err := s.conn.Write(raw); err != nil {
+		r.closeStream(s.id, "write failed: "+err.Error())
+		return
+	}
+
+	ack := Message{Type: "relay_ack", Ts: nowMs(), StreamId: s.id, Seq: msg.Seq, Bytes: int64(len(raw))}
+	if err := r.agent.send(ack); err != nil {
+		log.Printf("[ForgeAI Node] relay_ack send failed: %v", err)
+	}
+}
+
+// handleAck releases exactly the number of bytes the peer confirmed
+// receiving, letting a stalled pump() resume reading. Earlier this
+// released a fixed relayReadBufSize per ack regardless of how much was
+// actually acked, which let the window drift and stopped throttling.
+func (r *RelayMux) handleAck(msg Message) {
+	r.mu.Lock()
+	s, ok := r.streams[msg.StreamId]
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	s.unacked -= msg.Bytes
+	if s.unacked < 0 {
+		s.unacked = 0
+	}
+	s.mu.Unlock()
+}
+
+func (r *RelayMux) handleClose(msg Message) {
+	r.closeStream(msg.StreamId, msg.Reason)
+}
+
+func (r *RelayMux) closeStream(streamId, reason string) {
+	r.mu.Lock()
+	s, ok := r.streams[streamId]
+	if ok {
+		delete(r.streams, streamId)
+	}
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	close(s.closedCh)
+	s.conn.Close()
+	r.sendClose(streamId, reason)
+}
+
+func (r *RelayMux) sendClose(streamId, reason string) {
+	msg := Message{Type: "relay_close", Ts: nowMs(), StreamId: streamId, Reason: reason}
+	if err := r.agent.send(msg); err != nil {
+		log.Printf("[ForgeAI Node] relay_close send failed: %v", err)
+	}
+}
+
+// ─── Token Bucket ────────────────────────────────────────
+
+// tokenBucket is a minimal byte-rate limiter: take() blocks until enough
+// budget has refilled, refilling continuously at ratePerSec.
+type tokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	ratePerSec float64
+	last       time.Time
+}
+
+func newTokenBucket(ratePerSec int64) *tokenBucket {
+	return &tokenBucket{
+		tokens:     float64(ratePerSec),
+		ratePerSec: float64(ratePerSec),
+		last:       time.Now(),
+	}
+}
+
+func (b *tokenBucket) take(n int64) {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.ratePerSec
+		if b.tokens > b.ratePerSec {
+			b.tokens = b.ratePerSec
+		}
+		b.last = now
+
+		if b.tokens >= float64(n) {
+			b.tokens -= float64(n)
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// ─── Transport ───────────────────────────────────────────
+//
+// Agent talks to the outside world entirely through Transport, so the
+// reconnect/heartbeat/command machinery in main.go doesn't know whether
+// it's riding a raw WebSocket to the ForgeAI gateway or sitting on an
+// existing NATS/MQTT fleet. newTransport picks an implementation from
+// the --gateway URL's scheme.
+
+type Transport interface {
+	Dial() error
+	Send(msg Message) error
+	Recv() (Message, error)
+	Close() error
+}
+
+// newTransport selects a Transport by the gateway URL's scheme:
+// ws(s):// and bare http(s):// talk to the ForgeAI gateway directly,
+// nats:// joins an existing NATS fleet and mqtt(s):// an MQTT broker.
+func newTransport(gatewayURL, nodeId string) (Transport, error) {
+	u, err := url.Parse(gatewayURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "nats":
+		return newNATSTransport(gatewayURL, nodeId), nil
+	case "mqtt", "mqtts", "tcp", "ssl":
+		return newMQTTTransport(gatewayURL, nodeId), nil
+	default:
+		return newWSTransport(u)
+	}
+}
+
+// ─── WebSocket Transport ─────────────────────────────────
+
+type wsTransport struct {
+	url  string
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func newWSTransport(u *url.URL) (*wsTransport, error) {
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return nil, fmt.Errorf("unsupported gateway scheme %q", u.Scheme)
+	}
+	u.Path = "/ws/node"
+	return &wsTransport{url: u.String()}, nil
+}
+
+func (t *wsTransport) Dial() error {
+	log.Printf("[ForgeAI Node] Connecting to %s ...", t.url)
+	conn, _, err := websocket.DefaultDialer.Dial(t.url, nil)
+	if err != nil {
+		return fmt.Errorf("websocket dial: %w", err)
+	}
+	t.mu.Lock()
+	t.conn = conn
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *wsTransport) Send(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (t *wsTransport) Recv() (Message, error) {
+	var msg Message
+	if err := t.conn.ReadJSON(&msg); err != nil {
+		if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			return Message{}, fmt.Errorf("unexpected close: %w", err)
+		}
+		return Message{}, err
+	}
+	return msg, nil
+}
+
+func (t *wsTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	t.conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "shutdown"))
+	return t.conn.Close()
+}